@@ -4,10 +4,15 @@
 package charm
 
 import (
+	"archive/zip"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/juju/loggo"
 	"os/exec"
@@ -23,24 +28,194 @@ type Charm interface {
 	Metrics() *Metrics
 	Actions() *Actions
 	Revision() int
+
+	// Origin returns the structured revision-control provenance of the
+	// charm, or nil if it was not built from a recognised VCS checkout
+	// (see MaybeCreateVersionFile and ReadCharmOrigin).
+	Origin() *Origin
+
+	// Bases returns the OS/channel bases the charm supports. CharmDir and
+	// CharmArchive derive this from Meta().Series via basesFromSeries for
+	// charms that only declare legacy series.
+	Bases() []Base
+}
+
+// Default limits applied by ReadCharm. These are generous enough for any
+// real charm while still bounding how much a hostile archive can make the
+// reader allocate or write to disk.
+const (
+	defaultMaxUncompressedBytes = 200 * 1024 * 1024
+	defaultMaxFileCount         = 100000
+)
+
+// ReadOptions controls how ReadCharmWithOptions handles symlinks and
+// archive expansion.
+type ReadOptions struct {
+	// FollowSymlinks allows path itself to be a symlink, and allows
+	// symlinks inside a charm directory that resolve within the charm
+	// root. Defaults to true for directories, matching the historical
+	// behaviour relied on since the Launchpad fix for symlinked charm
+	// series directories.
+	FollowSymlinks bool
+	// MaxUncompressedBytes caps the total uncompressed size ReadCharm
+	// will expand from a charm archive. Zero means unlimited.
+	MaxUncompressedBytes int64
+	// MaxFileCount caps the number of entries ReadCharm will expand from
+	// a charm archive. Zero means unlimited.
+	MaxFileCount int
+	// AllowAbsoluteSymlinks allows a charm directory to contain symlinks
+	// with an absolute target. Such symlinks are refused by default
+	// because their destination depends on where the charm happens to
+	// be unpacked.
+	AllowAbsoluteSymlinks bool
+}
+
+// CharmSizeExceededError is returned by ReadCharmWithOptions when an
+// archive's file count or cumulative uncompressed size exceeds the
+// configured limit.
+type CharmSizeExceededError struct {
+	Path   string
+	Limit  int64
+	Actual int64
+}
+
+func (e *CharmSizeExceededError) Error() string {
+	return fmt.Sprintf(
+		"charm archive %q exceeds its size limit (limit %d, actual %d)",
+		e.Path, e.Limit, e.Actual,
+	)
+}
+
+// IsCharmSizeExceededError returns true if err is a CharmSizeExceededError.
+func IsCharmSizeExceededError(err error) bool {
+	_, ok := err.(*CharmSizeExceededError)
+	return ok
 }
 
 // ReadCharm reads a Charm from path, which can point to either a charm archive or a
-// charm directory.
+// charm directory. It applies sane default limits; use ReadCharmWithOptions
+// to change them.
 func ReadCharm(path string) (charm Charm, err error) {
+	return ReadCharmWithOptions(path, ReadOptions{
+		FollowSymlinks:        true,
+		MaxUncompressedBytes:  defaultMaxUncompressedBytes,
+		MaxFileCount:          defaultMaxFileCount,
+		AllowAbsoluteSymlinks: false,
+	})
+}
+
+// ReadCharmWithOptions reads a Charm from path exactly as ReadCharm does,
+// except that opts controls how defensively it treats symlinks (including
+// path itself) and, for archives, how much it is willing to expand.
+func ReadCharmWithOptions(path string, opts ReadOptions) (charm Charm, err error) {
+	topInfo, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	if topInfo.Mode()&os.ModeSymlink != 0 {
+		if !opts.FollowSymlinks {
+			return nil, fmt.Errorf("charm path %q is a symlink", path)
+		}
+		resolved, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return nil, err
+		}
+		path = resolved
+	}
+
 	info, err := os.Stat(path)
 	if err != nil {
 		return nil, err
 	}
 	if info.IsDir() {
-		charm, err = ReadCharmDir(path)
-	} else {
-		charm, err = ReadCharmArchive(path)
+		if err := checkDirSymlinks(path, opts); err != nil {
+			return nil, err
+		}
+		return ReadCharmDir(path)
 	}
-	if err != nil {
+	if err := checkArchiveLimits(path, opts); err != nil {
 		return nil, err
 	}
-	return charm, nil
+	return ReadCharmArchive(path)
+}
+
+// checkDirSymlinks walks root looking for symlinks. If opts.FollowSymlinks
+// is false, any symlink is refused outright. Otherwise it refuses symlinks
+// that are absolute (unless opts.AllowAbsoluteSymlinks), that resolve
+// outside root, or that form a cycle, returning an error describing the
+// first one found.
+func checkDirSymlinks(root string, opts ReadOptions) error {
+	// Targets are compared against the fully resolved root, so that a
+	// symlink in root's own path does not make every target look external.
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type()&os.ModeSymlink == 0 {
+			return nil
+		}
+		if !opts.FollowSymlinks {
+			return fmt.Errorf("charm dir contains symlink %q and FollowSymlinks is false", p)
+		}
+		target, err := os.Readlink(p)
+		if err != nil {
+			return err
+		}
+		if filepath.IsAbs(target) && !opts.AllowAbsoluteSymlinks {
+			return fmt.Errorf("charm dir contains absolute symlink %q", p)
+		}
+		resolved, err := filepath.EvalSymlinks(p)
+		if err != nil {
+			return fmt.Errorf("charm dir contains broken or cyclic symlink %q: %w", p, err)
+		}
+		rel, err := filepath.Rel(realRoot, resolved)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("charm dir contains symlink %q pointing outside the charm root", p)
+		}
+		return nil
+	})
+}
+
+// checkArchiveLimits opens the zip archive at path and verifies that none
+// of its entries would zip-slip outside the extraction destination, and
+// that its file count and cumulative uncompressed size stay within opts'
+// limits, without actually expanding it.
+func checkArchiveLimits(path string, opts ReadOptions) error {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if opts.MaxFileCount > 0 && len(r.File) > opts.MaxFileCount {
+		return &CharmSizeExceededError{Path: path, Limit: int64(opts.MaxFileCount), Actual: int64(len(r.File))}
+	}
+
+	var total int64
+	for _, f := range r.File {
+		if err := checkZipEntryPath(f.Name); err != nil {
+			return err
+		}
+		total += int64(f.UncompressedSize64)
+		if opts.MaxUncompressedBytes > 0 && total > opts.MaxUncompressedBytes {
+			return &CharmSizeExceededError{Path: path, Limit: opts.MaxUncompressedBytes, Actual: total}
+		}
+	}
+	return nil
+}
+
+// checkZipEntryPath rejects a zip entry name that would escape the
+// destination directory it is extracted into (zip-slip).
+func checkZipEntryPath(name string) error {
+	cleaned := filepath.Clean(name)
+	if filepath.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("charm archive entry %q would extract outside the destination", name)
+	}
+	return nil
 }
 
 // SeriesForCharm takes a requested series and a list of series supported by a
@@ -102,38 +277,627 @@ func IsUnsupportedSeriesError(err error) bool {
 	return ok
 }
 
+// SeriesReason explains why SelectSeries resolved to the series it did.
+type SeriesReason int
+
+const (
+	// ReasonUserRequested means the user asked for this series directly
+	// and it is supported by the charm.
+	ReasonUserRequested SeriesReason = iota
+	// ReasonBundle means the series came from the bundle that is
+	// deploying the charm.
+	ReasonBundle
+	// ReasonSingleCharmSeries means the charm declares exactly one
+	// (legacy) series and no series was otherwise requested.
+	ReasonSingleCharmSeries
+	// ReasonDefaultCharmSeries means the first of the charm's supported
+	// series was used because nothing else was requested.
+	ReasonDefaultCharmSeries
+	// ReasonModelDefault means the model's default series was used
+	// because the charm does not declare any series of its own.
+	ReasonModelDefault
+	// ReasonForced means the requested series is not supported by the
+	// charm, but was used anyway because Force was set.
+	ReasonForced
+)
+
+// SeriesSelectParams carries the inputs SelectSeries needs to reconcile a
+// requested series with what the charm, the bundle and the model allow.
+type SeriesSelectParams struct {
+	// RequestedSeries is the series explicitly asked for, by the user or
+	// by a bundle, if any.
+	RequestedSeries string
+	// SeriesFromCharm is the single series declared by a legacy charm
+	// via its metadata, if any.
+	SeriesFromCharm string
+	// SupportedSeries is the list of series the charm declares support
+	// for.
+	SupportedSeries []string
+	// ModelDefaultSeries is the model's configured default series, used
+	// only when the charm itself does not narrow the choice.
+	ModelDefaultSeries string
+	// FromBundle is true if RequestedSeries came from a bundle rather
+	// than being requested directly by the user.
+	FromBundle bool
+	// Force allows RequestedSeries to be used even if it is not in
+	// SupportedSeries.
+	Force bool
+}
+
+// SelectSeries reconciles a requested series against a charm's supported
+// series, the model's default series and a bundle, in the same order of
+// precedence as the command line and API layers already apply by hand:
+// a requested series wins if it is supported (or Force is set); otherwise
+// a legacy charm's single declared series wins; otherwise the first of the
+// charm's supported series is used; otherwise the model default is used.
+// If none of those apply, it returns a missingSeriesError. If a requested
+// series is rejected for being unsupported without Force, it returns an
+// unsupportedSeriesError, exactly as SeriesForCharm does, so existing
+// IsUnsupportedSeriesError callers keep working.
+func SelectSeries(params SeriesSelectParams) (series string, reason SeriesReason, err error) {
+	if params.RequestedSeries != "" {
+		if len(params.SupportedSeries) == 0 {
+			// Legacy charm with no declared series; nothing to validate against.
+			return params.RequestedSeries, reasonForRequest(params), nil
+		}
+		if seriesSupported(params.RequestedSeries, params.SupportedSeries) {
+			return params.RequestedSeries, reasonForRequest(params), nil
+		}
+		if params.Force {
+			return params.RequestedSeries, ReasonForced, nil
+		}
+		return "", 0, &unsupportedSeriesError{params.RequestedSeries, params.SupportedSeries}
+	}
+	if params.SeriesFromCharm != "" {
+		return params.SeriesFromCharm, ReasonSingleCharmSeries, nil
+	}
+	if len(params.SupportedSeries) > 0 {
+		return params.SupportedSeries[0], ReasonDefaultCharmSeries, nil
+	}
+	if params.ModelDefaultSeries != "" {
+		return params.ModelDefaultSeries, ReasonModelDefault, nil
+	}
+	return "", 0, missingSeriesError
+}
+
+// reasonForRequest reports whether an accepted, supported request came
+// from the user directly or by way of a bundle.
+func reasonForRequest(params SeriesSelectParams) SeriesReason {
+	if params.FromBundle {
+		return ReasonBundle
+	}
+	return ReasonUserRequested
+}
+
+// seriesSupported reports whether series appears in supported.
+func seriesSupported(series string, supported []string) bool {
+	for _, s := range supported {
+		if s == series {
+			return true
+		}
+	}
+	return false
+}
+
+// Base represents an operating system and a channel on that OS, e.g.
+// "ubuntu@22.04", the replacement for series names as the unit of
+// compatibility between a charm and the machine or container it runs on.
+type Base struct {
+	// OS is the operating system name, e.g. "ubuntu" or "centos".
+	OS string
+	// Channel is the OS version or release, e.g. "22.04".
+	Channel string
+	// Risk is the channel's risk level, e.g. "stable", "edge"; an empty
+	// Risk is treated as "stable", and Risk does not affect IsCompatible.
+	Risk string
+}
+
+// ParseBase parses a base in "os@channel" or "os@channel/risk" form.
+func ParseBase(s string) (Base, error) {
+	osName, rest, ok := strings.Cut(s, "@")
+	if !ok || osName == "" || rest == "" {
+		return Base{}, fmt.Errorf("base %q is not in os@channel form", s)
+	}
+	channel, risk, _ := strings.Cut(rest, "/")
+	return Base{OS: osName, Channel: channel, Risk: risk}, nil
+}
+
+// String returns the "os@channel" or "os@channel/risk" form of b.
+func (b Base) String() string {
+	if b.Risk == "" || b.Risk == "stable" {
+		return fmt.Sprintf("%s@%s", b.OS, b.Channel)
+	}
+	return fmt.Sprintf("%s@%s/%s", b.OS, b.Channel, b.Risk)
+}
+
+// IsCompatible reports whether b and other identify the same OS and
+// channel. Risk is ignored, since it selects a publication stream rather
+// than a different runtime.
+func (b Base) IsCompatible(other Base) bool {
+	return b.OS == other.OS && b.Channel == other.Channel
+}
+
+// BaseForCharm takes a requested base and a list of bases supported by a
+// charm and returns the base which is relevant, mirroring SeriesForCharm.
+// If the requested base is the zero Base, the first supported base is
+// used, otherwise the requested base is validated against the supported
+// bases.
+func BaseForCharm(requested Base, supported []Base) (Base, error) {
+	// Old charm with no supported bases.
+	if len(supported) == 0 {
+		if requested == (Base{}) {
+			return Base{}, missingBaseError
+		}
+		return requested, nil
+	}
+	// Use the charm default.
+	if requested == (Base{}) {
+		return supported[0], nil
+	}
+	for _, b := range supported {
+		if b.IsCompatible(requested) {
+			return requested, nil
+		}
+	}
+	return Base{}, &unsupportedBaseError{requested, supported}
+}
+
+// missingBaseError is used to denote that BaseForCharm could not determine
+// a base because a legacy charm did not declare any.
+var missingBaseError = fmt.Errorf("base not specified and charm does not define any")
+
+// IsMissingBaseError returns true if err is a missingBaseError.
+func IsMissingBaseError(err error) bool {
+	return err == missingBaseError
+}
+
+// unsupportedBaseError represents an error indicating that the requested
+// base is not supported by the charm.
+type unsupportedBaseError struct {
+	requestedBase  Base
+	supportedBases []Base
+}
+
+func (e *unsupportedBaseError) Error() string {
+	supported := make([]string, len(e.supportedBases))
+	for i, b := range e.supportedBases {
+		supported[i] = b.String()
+	}
+	return fmt.Sprintf(
+		"base %q not supported by charm, supported bases are: %s",
+		e.requestedBase, strings.Join(supported, ","),
+	)
+}
+
+// IsUnsupportedBaseError returns true if err is an unsupportedBaseError.
+func IsUnsupportedBaseError(err error) bool {
+	_, ok := err.(*unsupportedBaseError)
+	return ok
+}
+
+// seriesBases pairs a legacy series name with the Base it corresponds to,
+// for the series that are known to the charm store and Juju's supported
+// clouds.
+var seriesBases = []struct {
+	series string
+	base   Base
+}{
+	{"precise", Base{OS: "ubuntu", Channel: "12.04"}},
+	{"trusty", Base{OS: "ubuntu", Channel: "14.04"}},
+	{"xenial", Base{OS: "ubuntu", Channel: "16.04"}},
+	{"bionic", Base{OS: "ubuntu", Channel: "18.04"}},
+	{"focal", Base{OS: "ubuntu", Channel: "20.04"}},
+	{"jammy", Base{OS: "ubuntu", Channel: "22.04"}},
+	{"centos7", Base{OS: "centos", Channel: "7"}},
+	{"centos8", Base{OS: "centos", Channel: "8"}},
+	{"kubernetes", Base{OS: "kubernetes", Channel: "kubernetes"}},
+}
+
+// BaseFromSeries converts a legacy series name to the Base it corresponds
+// to, for series known to this package.
+func BaseFromSeries(series string) (Base, error) {
+	for _, sb := range seriesBases {
+		if sb.series == series {
+			return sb.base, nil
+		}
+	}
+	return Base{}, fmt.Errorf("series %q has no known base", series)
+}
+
+// SeriesFromBase converts a Base back to the legacy series name it
+// corresponds to, for bases known to this package.
+func SeriesFromBase(base Base) (string, error) {
+	for _, sb := range seriesBases {
+		if sb.base.IsCompatible(base) {
+			return sb.series, nil
+		}
+	}
+	return "", fmt.Errorf("base %q has no known series", base)
+}
+
+// basesFromSeries converts a charm's legacy Series list into Bases,
+// silently dropping any series this package cannot map - used by CharmDir
+// and CharmArchive to implement Charm.Bases for charms that only declare
+// legacy series.
+func basesFromSeries(series []string) []Base {
+	var bases []Base
+	for _, s := range series {
+		if base, err := BaseFromSeries(s); err == nil {
+			bases = append(bases, base)
+		}
+	}
+	return bases
+}
+
+// Bases implements Charm.Bases by deriving it from the charm's legacy
+// Series list; CharmDir does not yet support declaring bases directly.
+func (d *CharmDir) Bases() []Base {
+	return basesFromSeries(d.Meta().Series)
+}
+
+// Bases implements Charm.Bases by deriving it from the charm's legacy
+// Series list; CharmArchive does not yet support declaring bases directly.
+func (a *CharmArchive) Bases() []Base {
+	return basesFromSeries(a.Meta().Series)
+}
+
+// VersionProvider is implemented by each version control system that
+// MaybeCreateVersionFile knows how to query. Registering a VersionProvider
+// in VersionProviders lets downstream code teach MaybeCreateVersionFile
+// about a new SCM without patching this package.
+type VersionProvider interface {
+	// Name identifies the version control system, for logging.
+	Name() string
+	// Detect reports whether path is a working tree managed by this VCS.
+	Detect(path string) bool
+	// Commands returns one or more candidate commands that print a charm
+	// version identifier, tried in order until one succeeds. Each command
+	// is run with path as its working directory.
+	Commands(path string) [][]string
+	// Normalise turns the raw, successful command output into the string
+	// that gets written to the version file.
+	Normalise(output []byte) string
+	// Origin gathers the structured provenance metadata written to
+	// version.json, shelling out to the VCS as required.
+	Origin(path string) (*Origin, error)
+}
+
+// Origin records where a charm's code came from, mirroring the detail a Go
+// module's "Origin" block records about its source control history. It is
+// written alongside the plain-text version file as version.json.
+type Origin struct {
+	// VCS is the name of the version control system the charm was read
+	// from, e.g. "git", "bzr", "hg" or "fossil".
+	VCS string `json:"vcs"`
+	// Repo is the configured remote/upstream location of the checkout,
+	// if any.
+	Repo string `json:"repo,omitempty"`
+	// Ref is the symbolic reference checked out, e.g. "refs/heads/main",
+	// empty if the checkout is not on a named branch (detached HEAD).
+	Ref string `json:"ref,omitempty"`
+	// Hash is the revision identifier of the checked out commit.
+	Hash string `json:"hash,omitempty"`
+	// CommitTime is the commit time of Hash, in RFC3339 form.
+	CommitTime string `json:"commitTime,omitempty"`
+	// Dirty is true if the working tree has uncommitted changes.
+	Dirty bool `json:"dirty"`
+	// Subdir is the path of the charm within the repository, relative to
+	// the repository root, empty if the charm is the repository root.
+	Subdir string `json:"subdir,omitempty"`
+}
+
+// versionJSONName is the filename of the structured sibling to the plain
+// "version" file.
+const versionJSONName = "version.json"
+
+// ReadCharmOrigin reads the version.json file previously written by
+// MaybeCreateVersionFile alongside the charm at path. It returns nil, nil
+// if the charm was never in a recognised revision control checkout.
+func ReadCharmOrigin(path string) (*Origin, error) {
+	data, err := os.ReadFile(filepath.Join(path, versionJSONName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseOrigin(data)
+}
+
+// parseOrigin unmarshals the contents of a version.json file, shared by
+// ReadCharmOrigin (reading from a charm directory) and CharmArchive.Origin
+// (reading from an entry inside the zip).
+func parseOrigin(data []byte) (*Origin, error) {
+	origin := &Origin{}
+	if err := json.Unmarshal(data, origin); err != nil {
+		return nil, err
+	}
+	return origin, nil
+}
+
+// Origin implements Charm.Origin by reading the version.json written
+// alongside the charm directory by MaybeCreateVersionFile, if any.
+func (d *CharmDir) Origin() *Origin {
+	origin, err := ReadCharmOrigin(d.Path)
+	if err != nil {
+		return nil
+	}
+	return origin
+}
+
+// Origin implements Charm.Origin by reading the version.json entry packed
+// into the charm archive by MaybeCreateVersionFile before it was bundled,
+// if any.
+func (a *CharmArchive) Origin() *Origin {
+	r, err := zip.OpenReader(a.Path)
+	if err != nil {
+		return nil
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		if f.Name != versionJSONName {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		if err != nil {
+			return nil
+		}
+		origin, err := parseOrigin(data)
+		if err != nil {
+			return nil
+		}
+		return origin
+	}
+	return nil
+}
+
+// runVCS runs a VCS subcommand in path and returns its trimmed stdout,
+// swallowing failure by returning the empty string - origin metadata is
+// best-effort and a missing remote or unborn branch should not prevent the
+// rest of the Origin from being populated.
+func runVCS(path string, args ...string) string {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = path
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// VersionProviders lists the version control systems that
+// MaybeCreateVersionFile recognises, in detection order. Downstream
+// packages may append their own VersionProvider to support other SCMs.
+var VersionProviders = []VersionProvider{
+	gitVersionProvider{},
+	bzrVersionProvider{},
+	hgVersionProvider{},
+	fossilVersionProvider{},
+	svnVersionProvider{},
+}
+
+type gitVersionProvider struct{}
+
+func (gitVersionProvider) Name() string { return "git" }
+
+func (gitVersionProvider) Detect(path string) bool {
+	_, err := os.Stat(filepath.Join(path, ".git"))
+	return err == nil
+}
+
+func (gitVersionProvider) Commands(path string) [][]string {
+	return [][]string{
+		// Works for annotated tags and gives a dirty suffix.
+		{"git", "describe", "--dirty"},
+		// Falls back for detached HEADs and histories with no tags.
+		{"git", "rev-parse", "HEAD"},
+	}
+}
+
+func (gitVersionProvider) Normalise(output []byte) string {
+	return strings.TrimSpace(string(output))
+}
+
+func (gitVersionProvider) Origin(path string) (*Origin, error) {
+	ref := runVCS(path, "git", "symbolic-ref", "-q", "HEAD")
+	status := runVCS(path, "git", "status", "--porcelain")
+	return &Origin{
+		VCS:        "git",
+		Repo:       runVCS(path, "git", "config", "--get", "remote.origin.url"),
+		Ref:        ref,
+		Hash:       runVCS(path, "git", "rev-parse", "HEAD"),
+		CommitTime: runVCS(path, "git", "log", "-1", "--format=%cI"),
+		Dirty:      status != "",
+		Subdir:     strings.TrimSuffix(runVCS(path, "git", "rev-parse", "--show-prefix"), "/"),
+	}, nil
+}
+
+type bzrVersionProvider struct{}
+
+func (bzrVersionProvider) Name() string { return "bzr" }
+
+func (bzrVersionProvider) Detect(path string) bool {
+	_, err := os.Stat(filepath.Join(path, ".bzr"))
+	return err == nil
+}
+
+func (bzrVersionProvider) Commands(path string) [][]string {
+	return [][]string{{"bzr", "revision-info"}}
+}
+
+func (bzrVersionProvider) Normalise(output []byte) string {
+	return strings.TrimSpace(string(output))
+}
+
+func (bzrVersionProvider) Origin(path string) (*Origin, error) {
+	var hash string
+	if fields := strings.Fields(runVCS(path, "bzr", "revision-info")); len(fields) >= 2 {
+		hash = fields[1]
+	}
+	return &Origin{
+		VCS:        "bzr",
+		Repo:       runVCS(path, "bzr", "config", "parent_location"),
+		Hash:       hash,
+		CommitTime: bzrLastCommitTime(path),
+		Dirty:      runVCS(path, "bzr", "status", "--short") != "",
+		Subdir:     relativeSubdir(path, runVCS(path, "bzr", "root")),
+	}, nil
+}
+
+// bzrLastCommitTime extracts the timestamp of the tip revision from
+// "bzr log -r-1 --show-ids" output and returns it in RFC3339 form, or as
+// printed by bzr if it is not in bzr's usual format.
+func bzrLastCommitTime(path string) string {
+	for _, line := range strings.Split(runVCS(path, "bzr", "log", "-r-1", "--show-ids"), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "timestamp:") {
+			ts := strings.TrimSpace(strings.TrimPrefix(line, "timestamp:"))
+			if t, err := time.Parse("Mon 2006-01-02 15:04:05 -0700", ts); err == nil {
+				return t.Format(time.RFC3339)
+			}
+			return ts
+		}
+	}
+	return ""
+}
+
+// relativeSubdir returns path's location relative to root, or "" if root is
+// unknown or path is the root itself.
+func relativeSubdir(path, root string) string {
+	if root == "" {
+		return ""
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return ""
+	}
+	return rel
+}
+
+type hgVersionProvider struct{}
+
+func (hgVersionProvider) Name() string { return "hg" }
+
+func (hgVersionProvider) Detect(path string) bool {
+	_, err := os.Stat(filepath.Join(path, ".hg"))
+	return err == nil
+}
+
+func (hgVersionProvider) Commands(path string) [][]string {
+	return [][]string{{"hg", "id", "--id"}}
+}
+
+func (hgVersionProvider) Normalise(output []byte) string {
+	return strings.TrimSpace(string(output))
+}
+
+func (hgVersionProvider) Origin(path string) (*Origin, error) {
+	return &Origin{
+		VCS:  "hg",
+		Repo: runVCS(path, "hg", "paths", "default"),
+		// The active bookmark, if any; hg's closest equivalent to a ref.
+		Ref:        runVCS(path, "hg", "id", "-B"),
+		Hash:       runVCS(path, "hg", "id", "-i"),
+		CommitTime: runVCS(path, "hg", "log", "-r", ".", "--template", "{date|rfc3339date}"),
+		Dirty:      runVCS(path, "hg", "status") != "",
+		Subdir:     relativeSubdir(path, runVCS(path, "hg", "root")),
+	}, nil
+}
+
+type fossilVersionProvider struct{}
+
+func (fossilVersionProvider) Name() string { return "fossil" }
+
+func (fossilVersionProvider) Detect(path string) bool {
+	if _, err := os.Stat(filepath.Join(path, ".fslckout")); err == nil {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(path, "_FOSSIL_"))
+	return err == nil
+}
+
+func (fossilVersionProvider) Commands(path string) [][]string {
+	return [][]string{{"fossil", "info"}}
+}
+
+func (fossilVersionProvider) Normalise(output []byte) string {
+	// "fossil info" prints a block of "key: value" lines; the checkout
+	// line's second field is the commit hash.
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.HasPrefix(line, "checkout:") {
+			if fields := strings.Fields(line); len(fields) >= 2 {
+				return fields[1]
+			}
+		}
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func (fossilVersionProvider) Origin(path string) (*Origin, error) {
+	origin := &Origin{VCS: "fossil"}
+	for _, line := range strings.Split(runVCS(path, "fossil", "info"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "repository:"):
+			origin.Repo = strings.TrimSpace(strings.TrimPrefix(line, "repository:"))
+		case strings.HasPrefix(line, "local-root:"):
+			origin.Subdir = relativeSubdir(path, strings.TrimSpace(strings.TrimPrefix(line, "local-root:")))
+		case strings.HasPrefix(line, "checkout:"):
+			if fields := strings.Fields(line); len(fields) >= 2 {
+				origin.Hash = fields[1]
+			}
+		case strings.HasPrefix(line, "tags:"):
+			origin.Ref = strings.TrimSpace(strings.TrimPrefix(line, "tags:"))
+		}
+	}
+	origin.Dirty = runVCS(path, "fossil", "changes") != ""
+	return origin, nil
+}
+
+type svnVersionProvider struct{}
+
+func (svnVersionProvider) Name() string { return "svn" }
+
+func (svnVersionProvider) Detect(path string) bool {
+	_, err := os.Stat(filepath.Join(path, ".svn"))
+	return err == nil
+}
+
+func (svnVersionProvider) Commands(path string) [][]string {
+	return [][]string{{"svnversion", "."}}
+}
+
+func (svnVersionProvider) Normalise(output []byte) string {
+	return strings.TrimSpace(string(output))
+}
+
+func (svnVersionProvider) Origin(path string) (*Origin, error) {
+	rev := runVCS(path, "svnversion", ".")
+	return &Origin{
+		VCS:    "svn",
+		Repo:   runVCS(path, "svn", "info", "--show-item", "url"),
+		Hash:   rev,
+		Dirty:  strings.Contains(rev, "M"),
+		Subdir: relativeSubdir(path, runVCS(path, "svn", "info", "--show-item", "wc-root")),
+	}, nil
+}
+
 // MaybeCreateVersionFile creates/overwrite charm version file.
 func MaybeCreateVersionFile(path string) error {
-	var charmVersion string
-	var cmdArgs []string
-	var err error
-	// Verify that it is revision control directory.
-	if _, err = os.Stat(filepath.Join(path, ".git")); err == nil {
-		// It is git version control.
-		cmdArgs = []string{"git", "describe", "--dirty"}
-	} else if _, err = os.Stat(filepath.Join(path, ".bzr")); err == nil {
-		// It is baazar.
-		cmdArgs = []string{"bzr", "revision-info"}
-	} else if _, err = os.Stat(filepath.Join(path, ".hg")); err == nil {
-		cmdArgs = []string{"hg", "id", "--id"}
-	} else {
+	provider := detectVersionProvider(path)
+	if provider == nil {
 		logger.Infof("Charm is not in revision control directory")
 		return nil
 	}
 
-	var args []string
-	for pos, arg := range cmdArgs {
-		if pos != 0 {
-			args = append(args, arg)
-		}
-	}
-	cmd := exec.Command(cmdArgs[0], args...)
-	outStr, err := cmd.CombinedOutput()
+	charmVersion, err := runVersionCommands(path, provider)
 	if err != nil {
-		logger.Infof("Command output: %v", outStr)
 		return err
 	}
-	charmVersion = string(outStr)
 
 	versionPath := filepath.Join(path, "version")
 	// Overwrite the existing version file.
@@ -148,5 +912,47 @@ func MaybeCreateVersionFile(path string) error {
 		return err
 	}
 
+	origin, err := provider.Origin(path)
+	if err != nil {
+		return err
+	}
+	originData, err := json.Marshal(origin)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(path, versionJSONName), originData, 0666); err != nil {
+		return err
+	}
+
 	return nil
 }
+
+// detectVersionProvider returns the first registered VersionProvider that
+// recognises path as one of its working trees, or nil if none do.
+func detectVersionProvider(path string) VersionProvider {
+	for _, provider := range VersionProviders {
+		if provider.Detect(path) {
+			return provider
+		}
+	}
+	return nil
+}
+
+// runVersionCommands tries each of the provider's candidate commands in
+// turn, returning the normalised output of the first one that succeeds.
+func runVersionCommands(path string, provider VersionProvider) (string, error) {
+	commands := provider.Commands(path)
+	var lastErr error
+	var lastOut []byte
+	for _, cmdArgs := range commands {
+		cmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
+		cmd.Dir = path
+		outStr, err := cmd.CombinedOutput()
+		if err == nil {
+			return provider.Normalise(outStr), nil
+		}
+		lastErr, lastOut = err, outStr
+	}
+	logger.Infof("Command output: %v", lastOut)
+	return "", lastErr
+}
@@ -0,0 +1,780 @@
+// Copyright 2011, 2012, 2013 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"archive/zip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestVersionProviderDetect(t *testing.T) {
+	tests := []struct {
+		provider VersionProvider
+		marker   string
+	}{
+		{gitVersionProvider{}, ".git"},
+		{bzrVersionProvider{}, ".bzr"},
+		{hgVersionProvider{}, ".hg"},
+		{fossilVersionProvider{}, ".fslckout"},
+		{svnVersionProvider{}, ".svn"},
+	}
+	for _, test := range tests {
+		t.Run(test.provider.Name(), func(t *testing.T) {
+			dir := t.TempDir()
+			if test.provider.Detect(dir) {
+				t.Fatalf("%s: Detect reported true before marker was created", test.provider.Name())
+			}
+			if err := os.Mkdir(filepath.Join(dir, test.marker), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if !test.provider.Detect(dir) {
+				t.Fatalf("%s: Detect reported false after %s was created", test.provider.Name(), test.marker)
+			}
+		})
+	}
+}
+
+func TestFossilVersionProviderDetectFossilFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "_FOSSIL_"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !(fossilVersionProvider{}).Detect(dir) {
+		t.Fatal("Detect did not recognise a _FOSSIL_ file")
+	}
+}
+
+func TestDetectVersionProviderNone(t *testing.T) {
+	dir := t.TempDir()
+	if p := detectVersionProvider(dir); p != nil {
+		t.Fatalf("expected no provider for a plain directory, got %s", p.Name())
+	}
+}
+
+func TestGitVersionProviderNormalise(t *testing.T) {
+	got := (gitVersionProvider{}).Normalise([]byte("v1.2.3-dirty\n"))
+	if want := "v1.2.3-dirty"; got != want {
+		t.Fatalf("Normalise() = %q, want %q", got, want)
+	}
+}
+
+func TestFossilVersionProviderNormalise(t *testing.T) {
+	output := "project-name: test\ncheckout:     abcdef0123 2020-01-01 00:00:00 UTC\ntags:         trunk\n"
+	got := (fossilVersionProvider{}).Normalise([]byte(output))
+	if want := "abcdef0123"; got != want {
+		t.Fatalf("Normalise() = %q, want %q", got, want)
+	}
+}
+
+// requireGit skips the test if git is not on PATH, since these tests shell
+// out to it for real.
+func requireGit(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+}
+
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v: %s", args, err, out)
+	}
+}
+
+func initGitRepo(t *testing.T) string {
+	t.Helper()
+	requireGit(t)
+	dir := t.TempDir()
+	runGit(t, dir, "init")
+	runGit(t, dir, "config", "user.email", "test@example.com")
+	runGit(t, dir, "config", "user.name", "test")
+	if err := os.WriteFile(filepath.Join(dir, "metadata.yaml"), []byte("name: test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "add", "metadata.yaml")
+	runGit(t, dir, "commit", "-m", "initial")
+	return dir
+}
+
+func TestMaybeCreateVersionFileGitNoTags(t *testing.T) {
+	dir := initGitRepo(t)
+
+	if err := MaybeCreateVersionFile(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := os.ReadFile(filepath.Join(dir, "version"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// No tags exist, so the "git describe" command falls back to the
+	// full commit hash from "git rev-parse HEAD".
+	if len(version) != 40 {
+		t.Fatalf("expected a 40-character commit hash with no tags, got %q", version)
+	}
+}
+
+func TestRunVersionCommandsFallsBackOnFailure(t *testing.T) {
+	dir := initGitRepo(t)
+
+	got, err := runVersionCommands(dir, gitVersionProvider{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := runVersionCommandsHead(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("runVersionCommands() = %q, want %q", got, want)
+	}
+}
+
+func runVersionCommandsHead(dir string) (string, error) {
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return (gitVersionProvider{}).Normalise(out), nil
+}
+
+func TestGitVersionProviderOrigin(t *testing.T) {
+	dir := initGitRepo(t)
+
+	origin, err := (gitVersionProvider{}).Origin(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if origin.VCS != "git" {
+		t.Fatalf("Origin().VCS = %q, want %q", origin.VCS, "git")
+	}
+	if len(origin.Hash) != 40 {
+		t.Fatalf("Origin().Hash = %q, want a 40-character commit hash", origin.Hash)
+	}
+	if origin.Dirty {
+		t.Fatal("Origin().Dirty = true right after a commit")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "metadata.yaml"), []byte("name: test\nsummary: changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	origin, err = (gitVersionProvider{}).Origin(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !origin.Dirty {
+		t.Fatal("Origin().Dirty = false with an uncommitted change")
+	}
+}
+
+func requireBzr(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("bzr"); err != nil {
+		t.Skip("bzr not available")
+	}
+}
+
+func runBzr(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("bzr", args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("bzr %v: %v: %s", args, err, out)
+	}
+}
+
+func initBzrRepo(t *testing.T) string {
+	t.Helper()
+	requireBzr(t)
+	dir := t.TempDir()
+	runBzr(t, dir, "init")
+	if err := os.WriteFile(filepath.Join(dir, "metadata.yaml"), []byte("name: test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runBzr(t, dir, "add", "metadata.yaml")
+	runBzr(t, dir, "commit", "-m", "initial", "--unchanged")
+	return dir
+}
+
+func TestBzrVersionProviderOrigin(t *testing.T) {
+	dir := initBzrRepo(t)
+
+	origin, err := (bzrVersionProvider{}).Origin(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if origin.VCS != "bzr" {
+		t.Fatalf("Origin().VCS = %q, want %q", origin.VCS, "bzr")
+	}
+	if origin.Hash == "" {
+		t.Fatal("Origin().Hash is empty after a commit")
+	}
+	if origin.Dirty {
+		t.Fatal("Origin().Dirty = true right after a commit")
+	}
+}
+
+func requireHg(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("hg"); err != nil {
+		t.Skip("hg not available")
+	}
+}
+
+func runHg(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("hg", args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("hg %v: %v: %s", args, err, out)
+	}
+}
+
+func initHgRepo(t *testing.T) string {
+	t.Helper()
+	requireHg(t)
+	dir := t.TempDir()
+	runHg(t, dir, "init")
+	if err := os.WriteFile(filepath.Join(dir, "metadata.yaml"), []byte("name: test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runHg(t, dir, "add", "metadata.yaml")
+	runHg(t, dir, "commit", "-m", "initial", "-u", "test")
+	return dir
+}
+
+func TestHgVersionProviderOrigin(t *testing.T) {
+	dir := initHgRepo(t)
+
+	origin, err := (hgVersionProvider{}).Origin(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if origin.VCS != "hg" {
+		t.Fatalf("Origin().VCS = %q, want %q", origin.VCS, "hg")
+	}
+	if origin.Hash == "" {
+		t.Fatal("Origin().Hash is empty after a commit")
+	}
+	if origin.Dirty {
+		t.Fatal("Origin().Dirty = true right after a commit")
+	}
+}
+
+func requireFossil(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("fossil"); err != nil {
+		t.Skip("fossil not available")
+	}
+}
+
+func runFossil(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("fossil", args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("fossil %v: %v: %s", args, err, out)
+	}
+}
+
+func initFossilRepo(t *testing.T) string {
+	t.Helper()
+	requireFossil(t)
+	dir := t.TempDir()
+	repoFile := filepath.Join(dir, "repo.fossil")
+	runFossil(t, dir, "init", repoFile)
+	runFossil(t, dir, "open", repoFile)
+	if err := os.WriteFile(filepath.Join(dir, "metadata.yaml"), []byte("name: test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runFossil(t, dir, "add", "metadata.yaml")
+	runFossil(t, dir, "commit", "-m", "initial", "--no-warnings")
+	return dir
+}
+
+func TestFossilVersionProviderOrigin(t *testing.T) {
+	dir := initFossilRepo(t)
+
+	origin, err := (fossilVersionProvider{}).Origin(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if origin.VCS != "fossil" {
+		t.Fatalf("Origin().VCS = %q, want %q", origin.VCS, "fossil")
+	}
+	if origin.Hash == "" {
+		t.Fatal("Origin().Hash is empty after a commit")
+	}
+	if origin.Dirty {
+		t.Fatal("Origin().Dirty = true right after a commit")
+	}
+}
+
+func requireSvn(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("svn"); err != nil {
+		t.Skip("svn not available")
+	}
+	if _, err := exec.LookPath("svnadmin"); err != nil {
+		t.Skip("svnadmin not available")
+	}
+}
+
+func initSvnRepo(t *testing.T) string {
+	t.Helper()
+	requireSvn(t)
+	root := t.TempDir()
+	repoPath := filepath.Join(root, "repo")
+	cmd := exec.Command("svnadmin", "create", repoPath)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("svnadmin create: %v: %s", err, out)
+	}
+	wc := filepath.Join(root, "wc")
+	cmd = exec.Command("svn", "checkout", "file://"+repoPath, wc)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("svn checkout: %v: %s", err, out)
+	}
+	if err := os.WriteFile(filepath.Join(wc, "metadata.yaml"), []byte("name: test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd = exec.Command("svn", "add", "metadata.yaml")
+	cmd.Dir = wc
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("svn add: %v: %s", err, out)
+	}
+	cmd = exec.Command("svn", "commit", "-m", "initial")
+	cmd.Dir = wc
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("svn commit: %v: %s", err, out)
+	}
+	return wc
+}
+
+func TestSvnVersionProviderOrigin(t *testing.T) {
+	dir := initSvnRepo(t)
+
+	origin, err := (svnVersionProvider{}).Origin(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if origin.VCS != "svn" {
+		t.Fatalf("Origin().VCS = %q, want %q", origin.VCS, "svn")
+	}
+	if origin.Hash == "" {
+		t.Fatal("Origin().Hash is empty after a commit")
+	}
+}
+
+func TestSelectSeries(t *testing.T) {
+	tests := []struct {
+		name            string
+		params          SeriesSelectParams
+		wantSeries      string
+		wantReason      SeriesReason
+		wantErr         error
+		wantUnsupported bool
+	}{
+		{
+			name: "requested series supported",
+			params: SeriesSelectParams{
+				RequestedSeries: "focal",
+				SupportedSeries: []string{"focal", "jammy"},
+			},
+			wantSeries: "focal",
+			wantReason: ReasonUserRequested,
+		},
+		{
+			name: "requested series supported from bundle",
+			params: SeriesSelectParams{
+				RequestedSeries: "focal",
+				SupportedSeries: []string{"focal", "jammy"},
+				FromBundle:      true,
+			},
+			wantSeries: "focal",
+			wantReason: ReasonBundle,
+		},
+		{
+			name: "requested series unsupported without force",
+			params: SeriesSelectParams{
+				RequestedSeries: "precise",
+				SupportedSeries: []string{"focal", "jammy"},
+			},
+			wantUnsupported: true,
+		},
+		{
+			name: "requested series unsupported with force",
+			params: SeriesSelectParams{
+				RequestedSeries: "precise",
+				SupportedSeries: []string{"focal", "jammy"},
+				Force:           true,
+			},
+			wantSeries: "precise",
+			wantReason: ReasonForced,
+		},
+		{
+			name: "requested series on legacy charm with no declared series",
+			params: SeriesSelectParams{
+				RequestedSeries: "precise",
+			},
+			wantSeries: "precise",
+			wantReason: ReasonUserRequested,
+		},
+		{
+			name: "legacy single charm series wins when nothing requested",
+			params: SeriesSelectParams{
+				SeriesFromCharm: "trusty",
+				SupportedSeries: []string{"focal"},
+			},
+			wantSeries: "trusty",
+			wantReason: ReasonSingleCharmSeries,
+		},
+		{
+			name: "first supported series used as the default",
+			params: SeriesSelectParams{
+				SupportedSeries: []string{"focal", "jammy"},
+			},
+			wantSeries: "focal",
+			wantReason: ReasonDefaultCharmSeries,
+		},
+		{
+			name: "model default used when charm declares nothing",
+			params: SeriesSelectParams{
+				ModelDefaultSeries: "jammy",
+			},
+			wantSeries: "jammy",
+			wantReason: ReasonModelDefault,
+		},
+		{
+			name:    "missing series error when nothing can be determined",
+			params:  SeriesSelectParams{},
+			wantErr: missingSeriesError,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			series, reason, err := SelectSeries(test.params)
+			switch {
+			case test.wantUnsupported:
+				if !IsUnsupportedSeriesError(err) {
+					t.Fatalf("SelectSeries() err = %v, want an unsupportedSeriesError", err)
+				}
+			case test.wantErr != nil:
+				if err != test.wantErr {
+					t.Fatalf("SelectSeries() err = %v, want %v", err, test.wantErr)
+				}
+			default:
+				if err != nil {
+					t.Fatalf("SelectSeries() unexpected err = %v", err)
+				}
+				if series != test.wantSeries {
+					t.Fatalf("SelectSeries() series = %q, want %q", series, test.wantSeries)
+				}
+				if reason != test.wantReason {
+					t.Fatalf("SelectSeries() reason = %v, want %v", reason, test.wantReason)
+				}
+			}
+		})
+	}
+}
+
+// writeZip builds a zip archive at dir/name containing entries, and
+// returns its path. Each entry's content is size bytes of zero padding.
+func writeZip(t *testing.T, dir, name string, entries map[string]int) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for entryName, size := range entries {
+		ew, err := w.Create(entryName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ew.Write(make([]byte, size)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCheckArchiveLimitsRejectsZipSlip(t *testing.T) {
+	dir := t.TempDir()
+	path := writeZip(t, dir, "evil.charm", map[string]int{
+		"metadata.yaml":       10,
+		"../../../etc/passwd": 10,
+	})
+
+	err := checkArchiveLimits(path, ReadOptions{})
+	if err == nil {
+		t.Fatal("expected an error for a zip-slip entry, got nil")
+	}
+}
+
+func TestCheckArchiveLimitsRejectsAbsoluteEntry(t *testing.T) {
+	dir := t.TempDir()
+	path := writeZip(t, dir, "evil.charm", map[string]int{
+		"/etc/passwd": 10,
+	})
+
+	err := checkArchiveLimits(path, ReadOptions{})
+	if err == nil {
+		t.Fatal("expected an error for an absolute entry path, got nil")
+	}
+}
+
+func TestCheckArchiveLimitsRejectsExcessFileCount(t *testing.T) {
+	dir := t.TempDir()
+	path := writeZip(t, dir, "big.charm", map[string]int{
+		"a.txt": 1,
+		"b.txt": 1,
+		"c.txt": 1,
+	})
+
+	err := checkArchiveLimits(path, ReadOptions{MaxFileCount: 2})
+	if !IsCharmSizeExceededError(err) {
+		t.Fatalf("checkArchiveLimits() err = %v, want a CharmSizeExceededError", err)
+	}
+}
+
+func TestCheckArchiveLimitsRejectsExcessUncompressedSize(t *testing.T) {
+	dir := t.TempDir()
+	path := writeZip(t, dir, "bomb.charm", map[string]int{
+		"payload.bin": 1024,
+	})
+
+	err := checkArchiveLimits(path, ReadOptions{MaxUncompressedBytes: 100})
+	if !IsCharmSizeExceededError(err) {
+		t.Fatalf("checkArchiveLimits() err = %v, want a CharmSizeExceededError", err)
+	}
+}
+
+func TestCheckArchiveLimitsAllowsWithinLimits(t *testing.T) {
+	dir := t.TempDir()
+	path := writeZip(t, dir, "ok.charm", map[string]int{
+		"metadata.yaml": 10,
+	})
+
+	if err := checkArchiveLimits(path, ReadOptions{MaxFileCount: 5, MaxUncompressedBytes: 1000}); err != nil {
+		t.Fatalf("checkArchiveLimits() unexpected err = %v", err)
+	}
+}
+
+func TestCheckDirSymlinksRejectsEscapingSymlink(t *testing.T) {
+	root := t.TempDir()
+	charmDir := filepath.Join(root, "charm")
+	if err := os.Mkdir(charmDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(root, "outside")
+	if err := os.WriteFile(outside, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(charmDir, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Allow absolute targets so the symlink is refused for escaping the
+	// charm root rather than for being absolute.
+	err := checkDirSymlinks(charmDir, ReadOptions{FollowSymlinks: true, AllowAbsoluteSymlinks: true})
+	if err == nil {
+		t.Fatal("expected an error for a symlink escaping the charm root, got nil")
+	}
+}
+
+func TestCheckDirSymlinksRejectsCycle(t *testing.T) {
+	charmDir := t.TempDir()
+	a := filepath.Join(charmDir, "a")
+	b := filepath.Join(charmDir, "b")
+	if err := os.Symlink(b, a); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(a, b); err != nil {
+		t.Fatal(err)
+	}
+
+	// Allow absolute targets so the links are refused for forming a cycle
+	// rather than for being absolute.
+	err := checkDirSymlinks(charmDir, ReadOptions{FollowSymlinks: true, AllowAbsoluteSymlinks: true})
+	if err == nil {
+		t.Fatal("expected an error for a symlink cycle, got nil")
+	}
+}
+
+func TestCheckDirSymlinksRejectsAnySymlinkWhenNotFollowing(t *testing.T) {
+	charmDir := t.TempDir()
+	target := filepath.Join(charmDir, "target")
+	if err := os.WriteFile(target, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, filepath.Join(charmDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	err := checkDirSymlinks(charmDir, ReadOptions{FollowSymlinks: false})
+	if err == nil {
+		t.Fatal("expected an error since FollowSymlinks is false, got nil")
+	}
+}
+
+func TestCheckDirSymlinksAllowsInternalSymlink(t *testing.T) {
+	charmDir := t.TempDir()
+	target := filepath.Join(charmDir, "target")
+	if err := os.WriteFile(target, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Use a relative target so the symlink isn't rejected for being
+	// absolute; checkDirSymlinks should follow it and find it stays
+	// within the charm root.
+	if err := os.Symlink("target", filepath.Join(charmDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkDirSymlinks(charmDir, ReadOptions{FollowSymlinks: true}); err != nil {
+		t.Fatalf("checkDirSymlinks() unexpected err = %v", err)
+	}
+}
+func TestParseBase(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Base
+		wantErr bool
+	}{
+		{name: "os and channel", input: "ubuntu@22.04", want: Base{OS: "ubuntu", Channel: "22.04"}},
+		{name: "os, channel and risk", input: "ubuntu@22.04/edge", want: Base{OS: "ubuntu", Channel: "22.04", Risk: "edge"}},
+		{name: "missing @", input: "ubuntu-22.04", wantErr: true},
+		{name: "empty os", input: "@22.04", wantErr: true},
+		{name: "empty channel", input: "ubuntu@", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseBase(test.input)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("ParseBase(%q) err = nil, want an error", test.input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseBase(%q) unexpected err = %v", test.input, err)
+			}
+			if got != test.want {
+				t.Fatalf("ParseBase(%q) = %+v, want %+v", test.input, got, test.want)
+			}
+		})
+	}
+}
+
+func TestBaseString(t *testing.T) {
+	tests := []struct {
+		base Base
+		want string
+	}{
+		{Base{OS: "ubuntu", Channel: "22.04"}, "ubuntu@22.04"},
+		{Base{OS: "ubuntu", Channel: "22.04", Risk: "stable"}, "ubuntu@22.04"},
+		{Base{OS: "ubuntu", Channel: "22.04", Risk: "edge"}, "ubuntu@22.04/edge"},
+	}
+	for _, test := range tests {
+		if got := test.base.String(); got != test.want {
+			t.Fatalf("%+v.String() = %q, want %q", test.base, got, test.want)
+		}
+	}
+}
+
+func TestBaseForCharm(t *testing.T) {
+	jammy := Base{OS: "ubuntu", Channel: "22.04"}
+	focal := Base{OS: "ubuntu", Channel: "20.04"}
+
+	tests := []struct {
+		name            string
+		requested       Base
+		supported       []Base
+		want            Base
+		wantUnsupported bool
+		wantMissing     bool
+	}{
+		{name: "requested base supported", requested: jammy, supported: []Base{jammy, focal}, want: jammy},
+		{name: "requested base respects risk-insensitive compatibility", requested: Base{OS: "ubuntu", Channel: "22.04", Risk: "edge"}, supported: []Base{jammy}, want: Base{OS: "ubuntu", Channel: "22.04", Risk: "edge"}},
+		{name: "zero value uses charm default", requested: Base{}, supported: []Base{focal, jammy}, want: focal},
+		{name: "requested base unsupported", requested: Base{OS: "centos", Channel: "7"}, supported: []Base{jammy}, wantUnsupported: true},
+		{name: "no supported bases and nothing requested", requested: Base{}, supported: nil, wantMissing: true},
+		{name: "no supported bases but a base was requested", requested: jammy, supported: nil, want: jammy},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := BaseForCharm(test.requested, test.supported)
+			switch {
+			case test.wantUnsupported:
+				if !IsUnsupportedBaseError(err) {
+					t.Fatalf("BaseForCharm() err = %v, want an unsupportedBaseError", err)
+				}
+			case test.wantMissing:
+				if !IsMissingBaseError(err) {
+					t.Fatalf("BaseForCharm() err = %v, want a missingBaseError", err)
+				}
+			default:
+				if err != nil {
+					t.Fatalf("BaseForCharm() unexpected err = %v", err)
+				}
+				if got != test.want {
+					t.Fatalf("BaseForCharm() = %+v, want %+v", got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBaseFromSeriesAndBack(t *testing.T) {
+	base, err := BaseFromSeries("jammy")
+	if err != nil {
+		t.Fatalf("BaseFromSeries(%q) unexpected err = %v", "jammy", err)
+	}
+	want := Base{OS: "ubuntu", Channel: "22.04"}
+	if base != want {
+		t.Fatalf("BaseFromSeries(%q) = %+v, want %+v", "jammy", base, want)
+	}
+
+	series, err := SeriesFromBase(base)
+	if err != nil {
+		t.Fatalf("SeriesFromBase(%+v) unexpected err = %v", base, err)
+	}
+	if series != "jammy" {
+		t.Fatalf("SeriesFromBase(%+v) = %q, want %q", base, series, "jammy")
+	}
+
+	if _, err := BaseFromSeries("plan9"); err == nil {
+		t.Fatal("BaseFromSeries(\"plan9\") err = nil, want an error for an unknown series")
+	}
+}
+
+func TestBasesFromSeriesDropsUnknownSeries(t *testing.T) {
+	got := basesFromSeries([]string{"jammy", "plan9", "focal"})
+	want := []Base{
+		{OS: "ubuntu", Channel: "22.04"},
+		{OS: "ubuntu", Channel: "20.04"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("basesFromSeries() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("basesFromSeries() = %+v, want %+v", got, want)
+		}
+	}
+}